@@ -0,0 +1,143 @@
+package graphql
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	lru "github.com/hashicorp/golang-lru"
+)
+
+// persistedQueryNotFound is the error message servers send, per the Apollo
+// APQ protocol, when they don't recognize a query hash.
+const persistedQueryNotFound = "PersistedQueryNotFound"
+
+// persistedQueryExtension is the `extensions.persistedQuery` sent with every
+// APQ request, version 1 of the protocol.
+type persistedQueryExtension struct {
+	Version    int    `json:"version"`
+	SHA256Hash string `json:"sha256Hash"`
+}
+
+// WithPersistedQueries enables Automatic Persisted Queries (APQ, Apollo's
+// protocol) on Do and DoGet: a query hash not yet known to be registered is
+// sent together with the full query text so the server can register it;
+// once a hash is confirmed registered it's cached, and later calls send the
+// hash alone. cacheSize bounds the in-process LRU of registered hashes.
+func WithPersistedQueries(cacheSize int) Option {
+	if cacheSize <= 0 {
+		cacheSize = 1
+	}
+	cache, _ := lru.New(cacheSize)
+	return func(c *Client) { c.apqCache = cache }
+}
+
+func queryHash(query string) string {
+	sum := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(sum[:])
+}
+
+func isPersistedQueryNotFound(err error) bool {
+	resp, ok := err.(*Response)
+	if !ok {
+		return false
+	}
+	for _, e := range resp.Errors {
+		if e.Message == persistedQueryNotFound {
+			return true
+		}
+	}
+	return false
+}
+
+// doPersisted sends req as an APQ request, omitting the query text when the
+// hash is already known to be registered, and falling back to a request
+// with the full query if the server replies PersistedQueryNotFound.
+func (c *Client) doPersisted(ctx context.Context, query, operationName string, variables JSON, build func(*Request) (*http.Request, error)) (*Response, error) {
+	hash := queryHash(query)
+	req := NewRequest(query, operationName, variables)
+	req.Extensions = JSON{"persistedQuery": persistedQueryExtension{Version: 1, SHA256Hash: hash}}
+	if _, registered := c.apqCache.Get(hash); registered {
+		req.Query = ""
+	}
+
+	httpReq, err := build(req)
+	if err != nil {
+		return nil, fmt.Errorf("graphql do error: %w", err)
+	}
+	resp, err := c.handler(ctx, req, httpReq)
+	if err == nil {
+		c.apqCache.Add(hash, struct{}{})
+		return resp, nil
+	}
+	if req.Query != "" || !isPersistedQueryNotFound(err) {
+		return nil, err
+	}
+
+	// The server didn't recognize the hash - register it by resending with
+	// the full query text.
+	req.Query = query
+	httpReq, err = build(req)
+	if err != nil {
+		return nil, fmt.Errorf("graphql do error: %w", err)
+	}
+	resp, err = c.handler(ctx, req, httpReq)
+	if err != nil {
+		return nil, err
+	}
+	c.apqCache.Add(hash, struct{}{})
+	return resp, nil
+}
+
+// doPersistedPost implements Do's APQ path, see WithPersistedQueries.
+func (c *Client) doPersistedPost(ctx context.Context, query, operationName string, variables JSON) (*Response, error) {
+	return c.doPersisted(ctx, query, operationName, variables, func(req *Request) (*http.Request, error) {
+		return c.buildJSONRequest(ctx, req)
+	})
+}
+
+// DoGet executes query as a cache-friendly Automatic Persisted Query sent
+// over HTTP GET, with the hash (and, on a registering request, the query
+// text) and variables encoded as URL query parameters. The client must have
+// been built with WithPersistedQueries.
+func (c *Client) DoGet(ctx context.Context, query, operationName string, variables JSON) (*Response, error) {
+	if c.apqCache == nil {
+		return nil, errors.New("graphql do get error: DoGet requires a client built with WithPersistedQueries")
+	}
+	return c.doPersisted(ctx, query, operationName, variables, func(req *Request) (*http.Request, error) {
+		return c.buildGetRequest(ctx, req)
+	})
+}
+
+func (c *Client) buildGetRequest(ctx context.Context, req *Request) (*http.Request, error) {
+	q := url.Values{}
+	q.Set("operationName", req.OperationName)
+	if req.Query != "" {
+		q.Set("query", req.Query)
+	}
+	if len(req.Variables) > 0 {
+		b, err := json.Marshal(req.Variables)
+		if err != nil {
+			return nil, fmt.Errorf("build get request error: %w", err)
+		}
+		q.Set("variables", string(b))
+	}
+	if len(req.Extensions) > 0 {
+		b, err := json.Marshal(req.Extensions)
+		if err != nil {
+			return nil, fmt.Errorf("build get request error: %w", err)
+		}
+		q.Set("extensions", string(b))
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url+"?"+q.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("build get request error: %w", err)
+	}
+	return httpReq, nil
+}
@@ -0,0 +1,54 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDoPersisted(t *testing.T) {
+	registered := make(map[string]bool)
+	var requests []Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req Request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("decode request: %v", err)
+		}
+		requests = append(requests, req)
+
+		var ext struct {
+			PersistedQuery persistedQueryExtension `json:"persistedQuery"`
+		}
+		b, _ := json.Marshal(req.Extensions)
+		json.Unmarshal(b, &ext)
+		hash := ext.PersistedQuery.SHA256Hash
+
+		if req.Query != "" {
+			registered[hash] = true
+		} else if !registered[hash] {
+			w.Write([]byte(`{"errors":[{"message":"PersistedQueryNotFound"}]}`))
+			return
+		}
+		w.Write([]byte(`{"data":{"ok":true}}`))
+	}))
+	defer srv.Close()
+
+	client := New(srv.URL, nil, WithPersistedQueries(10))
+
+	if _, err := client.Do(context.Background(), "query { ok }", "", nil); err != nil {
+		t.Fatalf("first Do() error = %v", err)
+	}
+	if len(requests) != 1 || requests[0].Query == "" {
+		t.Fatalf("first Do() requests = %+v, want a single request with the full query to register it", requests)
+	}
+
+	requests = nil
+	if _, err := client.Do(context.Background(), "query { ok }", "", nil); err != nil {
+		t.Fatalf("second Do() error = %v", err)
+	}
+	if len(requests) != 1 || requests[0].Query != "" {
+		t.Errorf("second Do() requests = %+v, want a single hash-only request", requests)
+	}
+}
@@ -0,0 +1,194 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// BatchOp is a single operation within a DoBatch call.
+type BatchOp struct {
+	Query         string
+	OperationName string
+	Variables     JSON
+}
+
+func (op BatchOp) toRequest() *Request {
+	return NewRequest(op.Query, op.OperationName, op.Variables)
+}
+
+// DoBatch sends ops as a single HTTP POST carrying a JSON array of
+// operations (the Apollo/express-graphql batch format) and returns their
+// responses in the same order. Unlike Do, a response with GraphQL errors is
+// returned alongside the others rather than as the error value - check
+// Response.HasError on each.
+//
+// DoBatch talks to the server directly: it does not go through
+// ResponseMiddleware (built around a single request/response, which a batch
+// isn't) and does not apply Automatic Persisted Queries hashing, even if the
+// client was built with WithPersistedQueries - every op is sent with its
+// full query text. RequestMiddleware still applies, since it wraps the
+// underlying http.RoundTripper that every request, batched or not, goes
+// through.
+func (c *Client) DoBatch(ctx context.Context, ops []BatchOp) ([]*Response, error) {
+	reqs := make([]*Request, len(ops))
+	for i, op := range ops {
+		reqs[i] = op.toRequest()
+	}
+
+	httpReq, err := c.buildBatchRequest(ctx, reqs)
+	if err != nil {
+		return nil, fmt.Errorf("graphql do batch error: %w", err)
+	}
+
+	httpResp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("graphql do batch error: %w", ctx.Err())
+		default:
+		}
+		return nil, fmt.Errorf("graphql do batch error: %w", err)
+	}
+	defer httpResp.Body.Close()
+
+	var resps []*Response
+	if err := json.NewDecoder(httpResp.Body).Decode(&resps); err != nil {
+		return nil, fmt.Errorf("graphql do batch error: %w", err)
+	}
+	if len(resps) != len(reqs) {
+		return nil, fmt.Errorf("graphql do batch error: got %d responses for %d operations", len(resps), len(reqs))
+	}
+	for i, resp := range resps {
+		resp.req = reqs[i]
+	}
+	return resps, nil
+}
+
+func (c *Client) buildBatchRequest(ctx context.Context, reqs []*Request) (*http.Request, error) {
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(reqs); err != nil {
+		return nil, fmt.Errorf("build http request error: %w", err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.url, &body)
+	if err != nil {
+		return nil, fmt.Errorf("build http request error: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	return httpReq, nil
+}
+
+// WithBatching enables auto-batching: concurrent Do calls made within window
+// of each other are coalesced into a single DoBatch request and their
+// results demultiplexed back to each caller, dataloader-style. A batch also
+// flushes early once maxBatch operations are pending. Do still returns a
+// *Response per call; DoBatch remains available for explicit batching.
+//
+// Coalesced calls are sent through DoBatch, so they inherit its limits:
+// WithPersistedQueries hashing is not applied (every op goes out with its
+// full query text) and WithResponseMiddleware does not run. Avoid combining
+// WithBatching with either if you need them on every call.
+func WithBatching(window time.Duration, maxBatch int) Option {
+	if maxBatch <= 0 {
+		maxBatch = 100
+	}
+	return func(c *Client) {
+		c.batcher = &batcher{client: c, window: window, maxBatch: maxBatch}
+	}
+}
+
+type batchItem struct {
+	op   BatchOp
+	done chan batchResult
+}
+
+type batchResult struct {
+	resp *Response
+	err  error
+}
+
+// batcher coalesces Do calls on a single Client into periodic DoBatch
+// requests.
+type batcher struct {
+	client   *Client
+	window   time.Duration
+	maxBatch int
+
+	mu      sync.Mutex
+	pending []batchItem
+	timer   *time.Timer
+}
+
+func (b *batcher) do(ctx context.Context, query, operationName string, variables JSON) (*Response, error) {
+	item := batchItem{
+		op:   BatchOp{Query: query, OperationName: operationName, Variables: variables},
+		done: make(chan batchResult, 1),
+	}
+	b.enqueue(item)
+
+	select {
+	case res := <-item.done:
+		return res.resp, res.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (b *batcher) enqueue(item batchItem) {
+	b.mu.Lock()
+	b.pending = append(b.pending, item)
+	if len(b.pending) >= b.maxBatch {
+		pending := b.pending
+		b.pending = nil
+		if b.timer != nil {
+			b.timer.Stop()
+			b.timer = nil
+		}
+		b.mu.Unlock()
+		b.flush(pending)
+		return
+	}
+	if b.timer == nil {
+		b.timer = time.AfterFunc(b.window, b.onTimer)
+	}
+	b.mu.Unlock()
+}
+
+func (b *batcher) onTimer() {
+	b.mu.Lock()
+	pending := b.pending
+	b.pending = nil
+	b.timer = nil
+	b.mu.Unlock()
+
+	if len(pending) > 0 {
+		b.flush(pending)
+	}
+}
+
+// flush sends pending as one DoBatch request. It runs detached from any
+// single caller's context since it serves a whole batch of callers.
+func (b *batcher) flush(pending []batchItem) {
+	ops := make([]BatchOp, len(pending))
+	for i, item := range pending {
+		ops[i] = item.op
+	}
+
+	resps, err := b.client.DoBatch(context.Background(), ops)
+	for i, item := range pending {
+		if err != nil {
+			item.done <- batchResult{err: err}
+			continue
+		}
+		resp := resps[i]
+		if resp.HasError() {
+			item.done <- batchResult{err: resp}
+			continue
+		}
+		item.done <- batchResult{resp: resp}
+	}
+}
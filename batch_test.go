@@ -0,0 +1,132 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDoBatch(t *testing.T) {
+	var gotBatches [][]Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqs []Request
+		if err := json.NewDecoder(r.Body).Decode(&reqs); err != nil {
+			t.Fatalf("decode batch: %v", err)
+		}
+		gotBatches = append(gotBatches, reqs)
+
+		w.Write([]byte(`[{"data":{"n":1}},{"data":{"n":2}}]`))
+	}))
+	defer srv.Close()
+
+	client := New(srv.URL, nil)
+	resps, err := client.DoBatch(context.Background(), []BatchOp{
+		{Query: "query { a }"},
+		{Query: "query { b }"},
+	})
+	if err != nil {
+		t.Fatalf("DoBatch() error = %v", err)
+	}
+	if len(resps) != 2 {
+		t.Fatalf("DoBatch() returned %d responses, want 2", len(resps))
+	}
+	if resps[0].Data["n"] != float64(1) || resps[1].Data["n"] != float64(2) {
+		t.Errorf("DoBatch() responses out of order: %+v", resps)
+	}
+	if len(gotBatches) != 1 || len(gotBatches[0]) != 2 {
+		t.Fatalf("server saw batches %+v, want a single batch of 2 operations", gotBatches)
+	}
+}
+
+func TestWithBatchingCoalesces(t *testing.T) {
+	var calls int
+	var mu sync.Mutex
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqs []Request
+		json.NewDecoder(r.Body).Decode(&reqs)
+
+		mu.Lock()
+		calls++
+		mu.Unlock()
+
+		resps := make([]JSON, len(reqs))
+		for i := range reqs {
+			resps[i] = JSON{"data": JSON{"n": i}}
+		}
+		b, _ := json.Marshal(resps)
+		w.Write(b)
+	}))
+	defer srv.Close()
+
+	client := New(srv.URL, nil, WithBatching(10*time.Millisecond, 10))
+
+	var wg sync.WaitGroup
+	errs := make([]error, 3)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := client.Do(context.Background(), "query { ok }", "", nil)
+			errs[i] = err
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("Do() #%d error = %v", i, err)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if calls != 1 {
+		t.Errorf("server saw %d HTTP requests, want 1 (all calls coalesced)", calls)
+	}
+}
+
+func TestWithBatchingFlushesOnMaxBatch(t *testing.T) {
+	var calls int
+	var mu sync.Mutex
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqs []Request
+		json.NewDecoder(r.Body).Decode(&reqs)
+
+		mu.Lock()
+		calls++
+		mu.Unlock()
+
+		resps := make([]JSON, len(reqs))
+		for i := range reqs {
+			resps[i] = JSON{"data": JSON{"n": i}}
+		}
+		b, _ := json.Marshal(resps)
+		w.Write(b)
+	}))
+	defer srv.Close()
+
+	// A long window means calls only flush via the maxBatch size trigger.
+	client := New(srv.URL, nil, WithBatching(time.Hour, 2))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.Do(context.Background(), "query { ok }", "", nil); err != nil {
+				t.Errorf("Do() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if calls != 1 {
+		t.Errorf("server saw %d HTTP requests, want 1 (flushed at maxBatch)", calls)
+	}
+}
@@ -7,10 +7,11 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"mime/multipart"
 	"net/http"
-	"strconv"
+	"sync"
+	"time"
 
+	lru "github.com/hashicorp/golang-lru"
 	"github.com/mitchellh/mapstructure"
 )
 
@@ -28,6 +29,7 @@ type Request struct {
 	OperationName string `json:"operationName"`
 	Query         string `json:"query"`
 	Variables     JSON   `json:"variables"`
+	Extensions    JSON   `json:"extensions,omitempty"`
 
 	Files []NamedReader
 }
@@ -78,20 +80,21 @@ type Response struct {
 // Example:
 //
 // If response data is
-// {
-//   "data": {
-//	   "person": {
-//	     "name": "Jack"
-//		 "age": 26
-// 	   }
-//   },
-// 	 "error": null
-// }
 //
-// type Person struct {
-//   name string
-//   age int
-// }
+//	{
+//	  "data": {
+//		   "person": {
+//		     "name": "Jack"
+//			 "age": 26
+//		   }
+//	  },
+//		 "error": null
+//	}
+//
+//	type Person struct {
+//	  name string
+//	  age int
+//	}
 //
 // var p Person
 // r.Guess("person", p)
@@ -133,14 +136,68 @@ type Client struct {
 
 	// httpClient do the lower http request.
 	httpClient *http.Client
+
+	// subProtocol picks the GraphQL-over-WebSocket protocol used by Subscribe.
+	subProtocol SubProtocol
+	// connectionParams is sent as the payload of the connection_init message,
+	// e.g. to carry an auth token.
+	connectionParams JSON
+	// keepalive is the ping interval for the graphql-transport-ws protocol.
+	// Zero disables client-initiated pings.
+	keepalive time.Duration
+
+	wsMu   sync.Mutex
+	wsConn *wsConnection
+
+	// apqCache, when non-nil, enables Automatic Persisted Queries for Do and
+	// DoGet, see WithPersistedQueries.
+	apqCache *lru.Cache
+
+	requestMiddleware  []RequestMiddleware
+	responseMiddleware []ResponseMiddleware
+	// handler is c.do wrapped with responseMiddleware; it's what Do,
+	// DoWithFiles and DoGet actually call.
+	handler ResponseHandler
+
+	// batcher, when non-nil, makes Do coalesce concurrent calls into
+	// DoBatch requests, see WithBatching.
+	batcher *batcher
+}
+
+// Option configures optional Client behaviour, see New.
+type Option func(*Client)
+
+// WithConnectionParams sets the payload sent with the WebSocket
+// connection_init message, commonly used to pass an auth token.
+func WithConnectionParams(params JSON) Option {
+	return func(c *Client) { c.connectionParams = params }
+}
+
+// WithSubProtocol picks the GraphQL-over-WebSocket protocol Subscribe speaks.
+// Defaults to SubProtocolGraphQLTransportWS.
+func WithSubProtocol(p SubProtocol) Option {
+	return func(c *Client) { c.subProtocol = p }
+}
+
+// WithKeepalive enables client-initiated ping messages on the subscription
+// WebSocket at the given interval. Only effective with
+// SubProtocolGraphQLTransportWS.
+func WithKeepalive(interval time.Duration) Option {
+	return func(c *Client) { c.keepalive = interval }
 }
 
 // New create a graphql client with url and http client.
-func New(url string, httpClient *http.Client) *Client {
+func New(url string, httpClient *http.Client, opts ...Option) *Client {
 	if httpClient == nil {
 		httpClient = http.DefaultClient
 	}
-	return &Client{url: url, httpClient: httpClient}
+	c := &Client{url: url, httpClient: httpClient, subProtocol: SubProtocolGraphQLTransportWS}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.httpClient = applyRequestMiddleware(c.httpClient, c.requestMiddleware)
+	c.handler = applyResponseMiddleware(c.do, c.responseMiddleware)
+	return c
 }
 
 // Copy a new graphql client with a http client.
@@ -148,7 +205,21 @@ func (c *Client) Copy(httpClient *http.Client) *Client {
 	if httpClient == nil {
 		httpClient = http.DefaultClient
 	}
-	return &Client{url: c.url, httpClient: httpClient}
+	nc := &Client{
+		url:                c.url,
+		subProtocol:        c.subProtocol,
+		connectionParams:   c.connectionParams,
+		keepalive:          c.keepalive,
+		apqCache:           c.apqCache,
+		requestMiddleware:  c.requestMiddleware,
+		responseMiddleware: c.responseMiddleware,
+	}
+	nc.httpClient = applyRequestMiddleware(httpClient, nc.requestMiddleware)
+	nc.handler = applyResponseMiddleware(nc.do, nc.responseMiddleware)
+	if c.batcher != nil {
+		nc.batcher = &batcher{client: nc, window: c.batcher.window, maxBatch: c.batcher.maxBatch}
+	}
+	return nc
 }
 
 func (c *Client) buildJSONRequest(ctx context.Context, req *Request) (*http.Request, error) {
@@ -188,97 +259,23 @@ func (c *Client) do(ctx context.Context, req *Request, httpReq *http.Request) (*
 	return resp, nil
 }
 
-// Do exec graphql query or mutation.
+// Do exec graphql query or mutation. If the client was built with
+// WithPersistedQueries, it is sent as an Automatic Persisted Query. If the
+// client was built with WithBatching, it is coalesced with other concurrent
+// Do calls into a single DoBatch request instead - see WithBatching's doc
+// comment for what that gives up.
 func (c *Client) Do(ctx context.Context, query, operationName string, variables JSON) (*Response, error) {
-	req := NewRequest(query, operationName, variables)
-	httpReq, err := c.buildJSONRequest(ctx, req)
-	if err != nil {
-		return nil, fmt.Errorf("graphql do error: %w", err)
-	}
-	return c.do(ctx, req, httpReq)
-}
-
-func writeField(w *multipart.Writer, fieldname string, value interface{}) error {
-	b, err := json.Marshal(value)
-	if err != nil {
-		return fmt.Errorf("write field %v error: %w", fieldname, err)
-	}
-	if err := w.WriteField(fieldname, string(b)); err != nil {
-		return fmt.Errorf("write field %v error: %w", fieldname, err)
-	}
-	return nil
-}
-
-func writeFile(w *multipart.Writer, fieldname string, file NamedReader) error {
-	f, err := w.CreateFormFile(fieldname, file.Name())
-	if err != nil {
-		return fmt.Errorf("write file %v error: %w", fieldname, err)
-	}
-	if _, err := io.Copy(f, file); err != nil {
-		return fmt.Errorf("write file %v error: %w", fieldname, err)
-	}
-	return nil
-}
-
-func (c *Client) buildFormDataRequest(ctx context.Context, req *Request, single bool) (*http.Request, error) {
-	if req.Files == nil || len(req.Files) == 0 {
-		return nil, errors.New("build form data request error: has no files")
-	}
-	var body bytes.Buffer
-	w := multipart.NewWriter(&body)
-
-	var files []NamedReader
-	m := make(JSON)
-	if single {
-		files = req.Files[:1]
-		req.Variables = JSON{"file": nil}
-		m["0"] = []string{"variables.file"}
-	} else {
-		files = req.Files
-		s := []*struct{}{}
-		for i := range files {
-			m[strconv.Itoa(i)] = []string{fmt.Sprintf("variables.files.%v", i)}
-			s = append(s, nil)
-		}
-		req.Variables = JSON{"files": s}
+	if c.batcher != nil {
+		return c.batcher.do(ctx, query, operationName, variables)
 	}
-	if err := writeField(w, "operations", req); err != nil {
-		return nil, fmt.Errorf("build form data request error: %w", err)
-	}
-	if err := writeField(w, "map", m); err != nil {
-		return nil, fmt.Errorf("build form data request error: %w", err)
-	}
-	for i, file := range files {
-		if err := writeFile(w, strconv.Itoa(i), file); err != nil {
-			return nil, fmt.Errorf("build form data request error: %w", err)
-		}
+	if c.apqCache != nil {
+		return c.doPersistedPost(ctx, query, operationName, variables)
 	}
-	w.Close()
 
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.url, &body)
-	if err != nil {
-		return nil, fmt.Errorf("build form data request error: %w", err)
-	}
-	httpReq.Header.Set("Content-Type", w.FormDataContentType())
-	return httpReq, nil
-}
-
-// SingleUpload implement [GraphQL multipart request specification](https://github.com/jaydenseric/graphql-multipart-request-spec)
-func (c *Client) SingleUpload(ctx context.Context, query, operationName string, file NamedReader) (*Response, error) {
-	req := NewUploadRequest(query, operationName, file)
-	httpReq, err := c.buildFormDataRequest(ctx, req, true)
-	if err != nil {
-		return nil, fmt.Errorf("graphql single upload error: %w", err)
-	}
-	return c.do(ctx, req, httpReq)
-}
-
-// MultiUpload implement [GraphQL multipart request specification](https://github.com/jaydenseric/graphql-multipart-request-spec)
-func (c *Client) MultiUpload(ctx context.Context, query, operationName string, file ...NamedReader) (*Response, error) {
-	req := NewUploadRequest(query, operationName, file...)
-	httpReq, err := c.buildFormDataRequest(ctx, req, false)
+	req := NewRequest(query, operationName, variables)
+	httpReq, err := c.buildJSONRequest(ctx, req)
 	if err != nil {
-		return nil, fmt.Errorf("graphql single upload error: %w", err)
+		return nil, fmt.Errorf("graphql do error: %w", err)
 	}
-	return c.do(ctx, req, httpReq)
+	return c.handler(ctx, req, httpReq)
 }
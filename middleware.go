@@ -0,0 +1,132 @@
+package graphql
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"net/http"
+)
+
+// RequestMiddleware wraps an http.RoundTripper with cross-cutting transport
+// behaviour - auth injection, logging, tracing spans, retry with backoff on
+// 5xx/network errors, rate limiting - without subclassing http.Client. See
+// WithRequestMiddleware.
+type RequestMiddleware func(next http.RoundTripper) http.RoundTripper
+
+// WithRequestMiddleware chains mw onto the Client's http.Transport, in the
+// order given: the first middleware sees the request first and the
+// response last.
+func WithRequestMiddleware(mw ...RequestMiddleware) Option {
+	return func(c *Client) { c.requestMiddleware = append(c.requestMiddleware, mw...) }
+}
+
+func applyRequestMiddleware(hc *http.Client, mw []RequestMiddleware) *http.Client {
+	if len(mw) == 0 {
+		return hc
+	}
+
+	transport := hc.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	for i := len(mw) - 1; i >= 0; i-- {
+		transport = mw[i](transport)
+	}
+
+	clone := *hc
+	clone.Transport = transport
+	return &clone
+}
+
+// ResponseHandler executes a built GraphQL request and returns its decoded
+// response.
+type ResponseHandler func(ctx context.Context, req *Request, httpReq *http.Request) (*Response, error)
+
+// ResponseMiddleware wraps a ResponseHandler to observe, or retry based on,
+// the decoded *Response - e.g. retrying when a GraphQL error's
+// extensions.code is "THROTTLED". See WithResponseMiddleware.
+type ResponseMiddleware func(next ResponseHandler) ResponseHandler
+
+// WithResponseMiddleware chains mw around the Client's response handling, in
+// the order given: the first middleware runs outermost.
+func WithResponseMiddleware(mw ...ResponseMiddleware) Option {
+	return func(c *Client) { c.responseMiddleware = append(c.responseMiddleware, mw...) }
+}
+
+func applyResponseMiddleware(base ResponseHandler, mw []ResponseMiddleware) ResponseHandler {
+	h := base
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](h)
+	}
+	return h
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+// WithBearerToken injects an `Authorization: Bearer <token>` header into
+// every outgoing request.
+func WithBearerToken(token string) RequestMiddleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			req = req.Clone(req.Context())
+			req.Header.Set("Authorization", "Bearer "+token)
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// WithRequestID sets a random X-Request-ID header on every outgoing request
+// that doesn't already carry one.
+func WithRequestID() RequestMiddleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Header.Get("X-Request-ID") != "" {
+				return next.RoundTrip(req)
+			}
+			var b [16]byte
+			if _, err := rand.Read(b[:]); err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Header.Set("X-Request-ID", hex.EncodeToString(b[:]))
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// WithGzip compresses the outgoing request body with gzip and sets
+// Content-Encoding, for servers that decompress request bodies.
+func WithGzip() RequestMiddleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Body == nil {
+				return next.RoundTrip(req)
+			}
+			body, err := io.ReadAll(req.Body)
+			req.Body.Close()
+			if err != nil {
+				return nil, err
+			}
+
+			var buf bytes.Buffer
+			gw := gzip.NewWriter(&buf)
+			if _, err := gw.Write(body); err != nil {
+				return nil, err
+			}
+			if err := gw.Close(); err != nil {
+				return nil, err
+			}
+
+			req = req.Clone(req.Context())
+			req.Body = io.NopCloser(&buf)
+			req.ContentLength = int64(buf.Len())
+			req.Header.Set("Content-Encoding", "gzip")
+			return next.RoundTrip(req)
+		})
+	}
+}
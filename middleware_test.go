@@ -0,0 +1,71 @@
+package graphql
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWithRequestMiddleware(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+			t.Errorf("Authorization header = %q, want %q", got, "Bearer secret")
+		}
+		if r.Header.Get("X-Request-ID") == "" {
+			t.Error("X-Request-ID header was not set")
+		}
+		w.Write([]byte(`{"data":{"ok":true}}`))
+	}))
+	defer srv.Close()
+
+	client := New(srv.URL, nil, WithRequestMiddleware(WithBearerToken("secret"), WithRequestID()))
+	if _, err := client.Do(context.Background(), "query { ok }", "", nil); err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+}
+
+func TestWithResponseMiddleware(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.Write([]byte(`{"errors":[{"message":"rate limited","extensions":{"code":"THROTTLED"}}]}`))
+			return
+		}
+		w.Write([]byte(`{"data":{"ok":true}}`))
+	}))
+	defer srv.Close()
+
+	retryThrottled := func(next ResponseHandler) ResponseHandler {
+		return func(ctx context.Context, req *Request, httpReq *http.Request) (*Response, error) {
+			resp, err := next(ctx, req, httpReq)
+			gqlErr, ok := err.(*Response)
+			if !ok || len(gqlErr.Errors) == 0 || gqlErr.Errors[0].Extensions["code"] != "THROTTLED" {
+				return resp, err
+			}
+
+			retryReq := httpReq.Clone(ctx)
+			if httpReq.GetBody != nil {
+				body, bodyErr := httpReq.GetBody()
+				if bodyErr != nil {
+					return resp, err
+				}
+				retryReq.Body = body
+			}
+			return next(ctx, req, retryReq)
+		}
+	}
+
+	client := New(srv.URL, nil, WithResponseMiddleware(retryThrottled))
+	resp, err := client.Do(context.Background(), "query { ok }", "", nil)
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("server saw %d calls, want 2 (initial + retry)", calls)
+	}
+	if resp.Data["ok"] != true {
+		t.Errorf("Do() data = %v, want ok=true", resp.Data)
+	}
+}
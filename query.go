@@ -0,0 +1,341 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Typer lets a type name itself when it is used as an operation variable or
+// struct field and the default scalar mapping (string -> String, bool ->
+// Boolean, integers -> Int, floats -> Float) isn't right, e.g. a custom
+// `DateTime` scalar. The underlying Go kind must still be one decodeValue
+// knows how to set (string, bool, a numeric kind, ...).
+type Typer interface {
+	GraphQLType() string
+}
+
+var typerType = reflect.TypeOf((*Typer)(nil)).Elem()
+
+func implementsTyper(t reflect.Type) bool {
+	return t.Implements(typerType) || reflect.PtrTo(t).Implements(typerType)
+}
+
+// ID is the GraphQL ID scalar, for use as a Query/Mutate variable or struct
+// field where the schema expects an ID rather than a String.
+type ID string
+
+// GraphQLType implements Typer.
+func (ID) GraphQLType() string { return "ID" }
+
+// Query executes query as a GraphQL "query" operation, building the
+// selection set from q's `graphql` struct tags and decoding the response
+// directly into q. q must be a non-nil pointer to a struct.
+//
+// Fields select by name:
+//
+//	type query struct {
+//		Human struct {
+//			Name string `graphql:"name"`
+//		} `graphql:"human(id: $id)"`
+//	}
+//
+// A slice field selects a list, and an embedded struct tagged
+// `graphql:"... on Type"` selects an inline fragment. Use ID or a type
+// implementing Typer for variables whose GraphQL type isn't the default
+// scalar mapping.
+func (c *Client) Query(ctx context.Context, q interface{}, variables JSON) error {
+	return c.exec(ctx, "query", q, variables)
+}
+
+// Mutate executes m as a GraphQL "mutation" operation. See Query for how m's
+// struct tags describe the selection set.
+func (c *Client) Mutate(ctx context.Context, m interface{}, variables JSON) error {
+	return c.exec(ctx, "mutation", m, variables)
+}
+
+func (c *Client) exec(ctx context.Context, operation string, v interface{}, variables JSON) error {
+	val := reflect.ValueOf(v)
+	if val.Kind() != reflect.Ptr || val.IsNil() || val.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("graphql %v error: v must be a non-nil pointer to a struct", operation)
+	}
+
+	query, err := constructQuery(operation, val.Elem().Type(), variables)
+	if err != nil {
+		return fmt.Errorf("graphql %v error: %w", operation, err)
+	}
+
+	resp, err := c.Do(ctx, query, "", variables)
+	if err != nil {
+		return err
+	}
+	if err := decodeStruct(resp.Data, val.Elem()); err != nil {
+		return fmt.Errorf("graphql %v error: %w", operation, err)
+	}
+	return nil
+}
+
+func constructQuery(operation string, t reflect.Type, variables JSON) (string, error) {
+	var buf bytes.Buffer
+	buf.WriteString(operation)
+
+	if len(variables) > 0 {
+		names := make([]string, 0, len(variables))
+		for name := range variables {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		buf.WriteString(" (")
+		for i, name := range names {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			typeName, err := variableType(variables[name])
+			if err != nil {
+				return "", fmt.Errorf("variable %v: %w", name, err)
+			}
+			fmt.Fprintf(&buf, "$%v: %v", name, typeName)
+		}
+		buf.WriteByte(')')
+	}
+
+	buf.WriteByte(' ')
+	if err := writeSelectionSet(&buf, t); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// variableType infers the GraphQL type of a Query/Mutate variable from its
+// Go value: a pointer (including a nil one) is nullable, anything else is
+// required ("!"). A type implementing Typer names its own scalar.
+func variableType(v interface{}) (string, error) {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		return "", errors.New("nil has no inferable GraphQL type, use a typed nil pointer instead")
+	}
+
+	required := true
+	for rv.Kind() == reflect.Ptr {
+		required = false
+		if rv.IsNil() {
+			rv = reflect.Zero(rv.Type().Elem())
+			break
+		}
+		rv = rv.Elem()
+	}
+
+	name, err := scalarTypeName(rv)
+	if err != nil {
+		return "", err
+	}
+	if required {
+		name += "!"
+	}
+	return name, nil
+}
+
+func scalarTypeName(rv reflect.Value) (string, error) {
+	if typer, ok := rv.Interface().(Typer); ok {
+		return typer.GraphQLType(), nil
+	}
+
+	switch rv.Kind() {
+	case reflect.String:
+		return "String", nil
+	case reflect.Bool:
+		return "Boolean", nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "Int", nil
+	case reflect.Float32, reflect.Float64:
+		return "Float", nil
+	case reflect.Slice, reflect.Array:
+		elemType, err := scalarTypeName(reflect.Zero(rv.Type().Elem()))
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("[%v!]", elemType), nil
+	default:
+		return "", fmt.Errorf("cannot infer a GraphQL type for %v, implement Typer", rv.Type())
+	}
+}
+
+// isInlineFragment reports whether a `graphql` tag selects an inline
+// fragment, e.g. "... on Human".
+func isInlineFragment(tag string) bool {
+	return strings.HasPrefix(strings.TrimSpace(tag), "... on ")
+}
+
+// selectionName returns the JSON key a `graphql` tag's result is keyed
+// under: the alias if the tag is "alias: field(args)", otherwise the field
+// name stripped of any arguments.
+func selectionName(tag string) string {
+	head := strings.TrimSpace(tag)
+	if i := strings.IndexByte(head, '('); i >= 0 {
+		head = head[:i]
+	}
+	if i := strings.IndexByte(head, ':'); i >= 0 {
+		head = head[:i]
+	}
+	return strings.TrimSpace(head)
+}
+
+// writeSelectionSet writes the `{ ... }` selection set for t, which must be
+// a struct, or a pointer/slice thereof.
+func writeSelectionSet(buf *bytes.Buffer, t reflect.Type) error {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || implementsTyper(t) {
+		return nil
+	}
+
+	buf.WriteByte('{')
+	first := true
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, ok := f.Tag.Lookup("graphql")
+		if !ok {
+			tag = f.Name
+		}
+		if tag == "-" {
+			continue
+		}
+		if !first {
+			buf.WriteByte(' ')
+		}
+		first = false
+
+		buf.WriteString(tag)
+		if err := writeSelectionSet(buf, f.Type); err != nil {
+			return fmt.Errorf("field %v: %w", f.Name, err)
+		}
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+// decodeStruct populates dst, a struct value, from m by matching each
+// field's `graphql` tag to its response key. An embedded struct tagged
+// `graphql:"... on Type"` is decoded from the same object, since GraphQL
+// flattens inline fragment fields into the parent selection.
+func decodeStruct(m map[string]interface{}, dst reflect.Value) error {
+	t := dst.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, ok := f.Tag.Lookup("graphql")
+		if !ok || tag == "-" {
+			continue
+		}
+
+		if isInlineFragment(tag) {
+			if err := decodeStruct(m, dst.Field(i)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		val, ok := m[selectionName(tag)]
+		if !ok {
+			continue
+		}
+		if err := decodeValue(val, dst.Field(i)); err != nil {
+			return fmt.Errorf("field %v: %w", f.Name, err)
+		}
+	}
+	return nil
+}
+
+func decodeValue(data interface{}, dst reflect.Value) error {
+	if data == nil {
+		return nil
+	}
+
+	switch dst.Kind() {
+	case reflect.Ptr:
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		return decodeValue(data, dst.Elem())
+	case reflect.Struct:
+		// writeSelectionSet treats a Typer-implementing struct as a scalar
+		// leaf, not an object with a selection set - decode it the same way,
+		// via its own json.Unmarshaler, instead of expecting a JSON object.
+		if implementsTyper(dst.Type()) {
+			b, err := json.Marshal(data)
+			if err != nil {
+				return fmt.Errorf("marshal %T: %w", data, err)
+			}
+			if err := json.Unmarshal(b, dst.Addr().Interface()); err != nil {
+				return fmt.Errorf("decode %v: %w", dst.Type(), err)
+			}
+			return nil
+		}
+
+		m, ok := data.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("expected object, got %T", data)
+		}
+		return decodeStruct(m, dst)
+	case reflect.Slice:
+		s, ok := data.([]interface{})
+		if !ok {
+			return fmt.Errorf("expected array, got %T", data)
+		}
+		out := reflect.MakeSlice(dst.Type(), len(s), len(s))
+		for i, item := range s {
+			if err := decodeValue(item, out.Index(i)); err != nil {
+				return err
+			}
+		}
+		dst.Set(out)
+		return nil
+	case reflect.String:
+		s, ok := data.(string)
+		if !ok {
+			return fmt.Errorf("expected string, got %T", data)
+		}
+		dst.SetString(s)
+		return nil
+	case reflect.Bool:
+		b, ok := data.(bool)
+		if !ok {
+			return fmt.Errorf("expected bool, got %T", data)
+		}
+		dst.SetBool(b)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := data.(float64)
+		if !ok {
+			return fmt.Errorf("expected number, got %T", data)
+		}
+		dst.SetInt(int64(n))
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, ok := data.(float64)
+		if !ok {
+			return fmt.Errorf("expected number, got %T", data)
+		}
+		dst.SetUint(uint64(n))
+		return nil
+	case reflect.Float32, reflect.Float64:
+		n, ok := data.(float64)
+		if !ok {
+			return fmt.Errorf("expected number, got %T", data)
+		}
+		dst.SetFloat(n)
+		return nil
+	case reflect.Interface:
+		dst.Set(reflect.ValueOf(data))
+		return nil
+	default:
+		return fmt.Errorf("unsupported field type %v", dst.Type())
+	}
+}
@@ -0,0 +1,158 @@
+package graphql
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type humanQuery struct {
+	Human struct {
+		Name    string `graphql:"name"`
+		Friends []struct {
+			Name string `graphql:"name"`
+		} `graphql:"friends"`
+	} `graphql:"human(id: $id)"`
+}
+
+func TestConstructQuery(t *testing.T) {
+	query, err := constructQuery("query", reflect.TypeOf(humanQuery{}), JSON{"id": ID("1000")})
+	if err != nil {
+		t.Fatalf("constructQuery() error = %v", err)
+	}
+	want := "query ($id: ID!) {human(id: $id){name friends{name}}}"
+	if query != want {
+		t.Errorf("constructQuery() = %q, want %q", query, want)
+	}
+}
+
+func TestDecodeStruct(t *testing.T) {
+	var q humanQuery
+	data := map[string]interface{}{
+		"human": map[string]interface{}{
+			"name": "Luke Skywalker",
+			"friends": []interface{}{
+				map[string]interface{}{"name": "Han Solo"},
+			},
+		},
+	}
+	if err := decodeStruct(data, reflect.ValueOf(&q).Elem()); err != nil {
+		t.Fatalf("decodeStruct() error = %v", err)
+	}
+
+	want := humanQuery{}
+	want.Human.Name = "Luke Skywalker"
+	want.Human.Friends = []struct {
+		Name string `graphql:"name"`
+	}{{Name: "Han Solo"}}
+
+	if !reflect.DeepEqual(q, want) {
+		t.Errorf("decodeStruct() = %+v, want %+v", q, want)
+	}
+}
+
+// timestamp is a struct-backed custom scalar, like a real DateTime type
+// would be: its Go Kind is Struct, but it implements Typer and round-trips
+// through JSON as a plain string rather than an object.
+type timestamp struct {
+	t time.Time
+}
+
+func (timestamp) GraphQLType() string { return "DateTime" }
+
+func (t timestamp) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.t.Format(time.RFC3339))
+}
+
+func (t *timestamp) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	parsed, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return err
+	}
+	t.t = parsed
+	return nil
+}
+
+type eventQuery struct {
+	Event struct {
+		Name    string    `graphql:"name"`
+		StartAt timestamp `graphql:"startAt"`
+	} `graphql:"event(id: $id)"`
+}
+
+func TestConstructQueryTyperStruct(t *testing.T) {
+	query, err := constructQuery("query", reflect.TypeOf(eventQuery{}), JSON{"id": ID("1")})
+	if err != nil {
+		t.Fatalf("constructQuery() error = %v", err)
+	}
+	want := "query ($id: ID!) {event(id: $id){name startAt}}"
+	if query != want {
+		t.Errorf("constructQuery() = %q, want %q", query, want)
+	}
+}
+
+func TestDecodeStructTyperStruct(t *testing.T) {
+	var q eventQuery
+	data := map[string]interface{}{
+		"event": map[string]interface{}{
+			"name":    "Launch",
+			"startAt": "2024-01-02T15:04:05Z",
+		},
+	}
+	if err := decodeStruct(data, reflect.ValueOf(&q).Elem()); err != nil {
+		t.Fatalf("decodeStruct() error = %v", err)
+	}
+
+	if q.Event.Name != "Launch" {
+		t.Errorf("Event.Name = %q, want %q", q.Event.Name, "Launch")
+	}
+	want, _ := time.Parse(time.RFC3339, "2024-01-02T15:04:05Z")
+	if !q.Event.StartAt.t.Equal(want) {
+		t.Errorf("Event.StartAt = %v, want %v", q.Event.StartAt.t, want)
+	}
+}
+
+type characterQuery struct {
+	Character struct {
+		Name  string `graphql:"name"`
+		Human struct {
+			HomePlanet string `graphql:"homePlanet"`
+		} `graphql:"... on Human"`
+	} `graphql:"character(id: $id)"`
+}
+
+func TestConstructQueryInlineFragment(t *testing.T) {
+	query, err := constructQuery("query", reflect.TypeOf(characterQuery{}), JSON{"id": ID("2001")})
+	if err != nil {
+		t.Fatalf("constructQuery() error = %v", err)
+	}
+	want := "query ($id: ID!) {character(id: $id){name ... on Human{homePlanet}}}"
+	if query != want {
+		t.Errorf("constructQuery() = %q, want %q", query, want)
+	}
+}
+
+func TestDecodeStructInlineFragment(t *testing.T) {
+	var q characterQuery
+	data := map[string]interface{}{
+		"character": map[string]interface{}{
+			"name":       "Leia Organa",
+			"homePlanet": "Alderaan",
+		},
+	}
+	if err := decodeStruct(data, reflect.ValueOf(&q).Elem()); err != nil {
+		t.Fatalf("decodeStruct() error = %v", err)
+	}
+
+	if q.Character.Name != "Leia Organa" {
+		t.Errorf("Character.Name = %q, want %q", q.Character.Name, "Leia Organa")
+	}
+	if q.Character.Human.HomePlanet != "Alderaan" {
+		t.Errorf("Character.Human.HomePlanet = %q, want %q", q.Character.Human.HomePlanet, "Alderaan")
+	}
+}
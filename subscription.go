@@ -0,0 +1,508 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// SubProtocol identifies which GraphQL-over-WebSocket subprotocol a subscription
+// connection speaks.
+type SubProtocol string
+
+const (
+	// SubProtocolGraphQLWS is the legacy `subscriptions-transport-ws` protocol,
+	// negotiated with the "graphql-ws" WebSocket subprotocol.
+	SubProtocolGraphQLWS SubProtocol = "graphql-ws"
+	// SubProtocolGraphQLTransportWS is the newer `graphql-ws` protocol,
+	// negotiated with the "graphql-transport-ws" WebSocket subprotocol.
+	SubProtocolGraphQLTransportWS SubProtocol = "graphql-transport-ws"
+)
+
+// legacy graphql-ws message types.
+const (
+	gwsConnectionInit      = "connection_init"
+	gwsConnectionAck       = "connection_ack"
+	gwsConnectionError     = "connection_error"
+	gwsConnectionTerminate = "connection_terminate"
+	gwsStart               = "start"
+	gwsStop                = "stop"
+	gwsData                = "data"
+	gwsError               = "error"
+	gwsComplete            = "complete"
+	gwsKeepAlive           = "ka"
+)
+
+// graphql-transport-ws message types.
+const (
+	twsConnectionInit = "connection_init"
+	twsConnectionAck  = "connection_ack"
+	twsSubscribe      = "subscribe"
+	twsNext           = "next"
+	twsError          = "error"
+	twsComplete       = "complete"
+	twsPing           = "ping"
+	twsPong           = "pong"
+)
+
+// wsMessage is the envelope used by both subprotocols.
+type wsMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// subscribePayload is the `payload` of a start/subscribe message.
+type subscribePayload struct {
+	OperationName string `json:"operationName,omitempty"`
+	Query         string `json:"query"`
+	Variables     JSON   `json:"variables,omitempty"`
+}
+
+// Subscription is a handle to an active GraphQL subscription opened by
+// Client.Subscribe. Results are delivered on C until the server sends
+// complete or the subscription is stopped by Close or ctx cancellation.
+type Subscription struct {
+	// C delivers one *Response per subscription event. It is closed only
+	// when the server sends complete; Close and ctx cancellation do not
+	// close it, since dispatch may still be delivering to it concurrently -
+	// stop reading from C once you've called Close.
+	C <-chan *Response
+
+	id     string
+	wc     *wsConnection
+	cancel context.CancelFunc
+	once   sync.Once
+}
+
+// Close stops the subscription and, once it was the last active subscription
+// on the connection, closes the underlying WebSocket. It does not close C.
+func (s *Subscription) Close() error {
+	s.cancel()
+	var err error
+	s.once.Do(func() {
+		err = s.wc.unsubscribe(s.id)
+	})
+	return err
+}
+
+// Subscribe opens a `subscription` operation over WebSocket and streams
+// results on the returned Subscription's channel. Cancelling ctx stops the
+// subscription and, once it was the last one active, closes the socket.
+func (c *Client) Subscribe(ctx context.Context, query, operationName string, variables JSON) (*Subscription, error) {
+	wc, err := c.ensureWSConn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("graphql subscribe error: %w", err)
+	}
+
+	wsub, err := wc.subscribe(query, operationName, variables)
+	if err != nil {
+		return nil, fmt.Errorf("graphql subscribe error: %w", err)
+	}
+	sctx, cancel := context.WithCancel(ctx)
+	sub := &Subscription{C: wsub.ch, id: wsub.id, wc: wc, cancel: cancel}
+
+	// Release this watcher as soon as either the caller cancels ctx/calls
+	// Close, or the subscription finishes server-side (wsub.done is closed
+	// by finish/unsubscribe) - otherwise a naturally-completing subscription
+	// whose caller never cancels ctx would leak this goroutine forever.
+	go func() {
+		select {
+		case <-sctx.Done():
+		case <-wsub.done:
+		}
+		sub.once.Do(func() {
+			wc.unsubscribe(wsub.id)
+		})
+	}()
+
+	return sub, nil
+}
+
+// ensureWSConn returns the client's shared subscription connection, dialing
+// one if none is currently open.
+func (c *Client) ensureWSConn(ctx context.Context) (*wsConnection, error) {
+	c.wsMu.Lock()
+	defer c.wsMu.Unlock()
+
+	if c.wsConn != nil {
+		return c.wsConn, nil
+	}
+
+	wc := &wsConnection{client: c, subs: make(map[string]*wsSubscription)}
+	if err := wc.connect(ctx); err != nil {
+		return nil, err
+	}
+	go wc.readLoop()
+	if c.keepalive > 0 && c.subProtocol == SubProtocolGraphQLTransportWS {
+		go wc.pingLoop()
+	}
+	c.wsConn = wc
+	return wc, nil
+}
+
+// wsSubscription is the state needed to re-issue a subscription after a
+// reconnect.
+type wsSubscription struct {
+	id            string
+	query         string
+	operationName string
+	variables     JSON
+	// ch is only ever sent to or closed by the read loop (dispatch and
+	// finish run on it, never concurrently with each other) once subscribe
+	// has registered it - subscribe itself closes it only on a failed send,
+	// before anything else has seen it - so unsubscribe
+	// - which runs on whatever goroutine called Subscription.Close - must
+	// never touch it; doing so would race the read loop's send, and since
+	// that send can block on a full channel, closing ch from unsubscribe
+	// could deadlock unsubscribe against a read loop that never drains.
+	ch chan *Response
+	// done is closed exactly once, by finish or unsubscribe (or by subscribe
+	// on a failed send), to signal the
+	// Subscribe watcher goroutine that it can stop watching this
+	// subscription.
+	done chan struct{}
+}
+
+// wsConnection multiplexes every active subscription for a Client over a
+// single WebSocket, reconnecting with backoff and re-subscribing as needed.
+type wsConnection struct {
+	client *Client
+
+	mu     sync.Mutex
+	conn   *websocket.Conn
+	subs   map[string]*wsSubscription
+	closed bool
+	nextID uint64
+}
+
+func wsURL(rawurl string) (string, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return "", err
+	}
+	switch u.Scheme {
+	case "http":
+		u.Scheme = "ws"
+	case "https":
+		u.Scheme = "wss"
+	}
+	return u.String(), nil
+}
+
+func (wc *wsConnection) connect(ctx context.Context) error {
+	target, err := wsURL(wc.client.url)
+	if err != nil {
+		return fmt.Errorf("graphql subscribe dial error: %w", err)
+	}
+
+	dialer := websocket.Dialer{Subprotocols: []string{string(wc.client.subProtocol)}}
+	conn, _, err := dialer.DialContext(ctx, target, nil)
+	if err != nil {
+		return fmt.Errorf("graphql subscribe dial error: %w", err)
+	}
+
+	payload, err := json.Marshal(wc.client.connectionParams)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("graphql subscribe dial error: %w", err)
+	}
+
+	initType, ackType := gwsConnectionInit, gwsConnectionAck
+	if wc.client.subProtocol == SubProtocolGraphQLTransportWS {
+		initType, ackType = twsConnectionInit, twsConnectionAck
+	}
+	if err := conn.WriteJSON(wsMessage{Type: initType, Payload: payload}); err != nil {
+		conn.Close()
+		return fmt.Errorf("graphql subscribe dial error: %w", err)
+	}
+
+	var ack wsMessage
+	if err := conn.ReadJSON(&ack); err != nil {
+		conn.Close()
+		return fmt.Errorf("graphql subscribe dial error: %w", err)
+	}
+	if ack.Type != ackType {
+		conn.Close()
+		return fmt.Errorf("graphql subscribe dial error: unexpected %q message", ack.Type)
+	}
+
+	wc.mu.Lock()
+	wc.conn = conn
+	wc.mu.Unlock()
+	return nil
+}
+
+func (wc *wsConnection) readLoop() {
+	for {
+		wc.mu.Lock()
+		conn := wc.conn
+		wc.mu.Unlock()
+		if conn == nil {
+			return
+		}
+
+		var msg wsMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			if wc.reconnect() {
+				continue
+			}
+			return
+		}
+		wc.handleMessage(msg)
+	}
+}
+
+func (wc *wsConnection) handleMessage(msg wsMessage) {
+	if wc.client.subProtocol == SubProtocolGraphQLTransportWS {
+		switch msg.Type {
+		case twsNext:
+			wc.dispatch(msg.ID, msg.Payload, false)
+		case twsError:
+			wc.dispatch(msg.ID, msg.Payload, true)
+		case twsComplete:
+			wc.finish(msg.ID)
+		case twsPing:
+			wc.writeMessage(wsMessage{Type: twsPong})
+		}
+		return
+	}
+
+	switch msg.Type {
+	case gwsData:
+		wc.dispatch(msg.ID, msg.Payload, false)
+	case gwsError, gwsConnectionError:
+		wc.dispatch(msg.ID, msg.Payload, true)
+	case gwsComplete:
+		wc.finish(msg.ID)
+	}
+}
+
+// dispatch delivers a next/data or error message to its subscription's
+// channel. A full channel blocks the read loop, same as a slow consumer
+// would in any single-connection multiplexed protocol.
+func (wc *wsConnection) dispatch(id string, payload json.RawMessage, isError bool) {
+	wc.mu.Lock()
+	sub, ok := wc.subs[id]
+	wc.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	resp := &Response{}
+	switch {
+	case isError:
+		var errs []*GraphQLError
+		if err := json.Unmarshal(payload, &errs); err != nil || len(errs) == 0 {
+			errs = []*GraphQLError{{Message: string(payload)}}
+		}
+		resp.Errors = errs
+	default:
+		if err := json.Unmarshal(payload, resp); err != nil {
+			resp.Errors = []*GraphQLError{{Message: fmt.Sprintf("decode subscription payload: %v", err)}}
+		}
+	}
+
+	sub.ch <- resp
+}
+
+// finish closes out a subscription that completed server-side. It only ever
+// runs on the read loop, the same goroutine that calls dispatch, so closing
+// sub.ch here can never race a concurrent send.
+func (wc *wsConnection) finish(id string) {
+	wc.mu.Lock()
+	sub, ok := wc.subs[id]
+	if ok {
+		delete(wc.subs, id)
+	}
+	wc.mu.Unlock()
+	if !ok {
+		return
+	}
+	close(sub.ch)
+	close(sub.done)
+}
+
+// subscribe registers and sends a new subscription, returning an error
+// without registering it if the subscribe message couldn't be written -
+// callers must not treat a nil error as "server received this".
+func (wc *wsConnection) subscribe(query, operationName string, variables JSON) (*wsSubscription, error) {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+
+	id := strconv.FormatUint(atomic.AddUint64(&wc.nextID, 1), 10)
+	sub := &wsSubscription{
+		id:            id,
+		query:         query,
+		operationName: operationName,
+		variables:     variables,
+		ch:            make(chan *Response, 16),
+		done:          make(chan struct{}),
+	}
+	wc.subs[id] = sub
+	if err := wc.sendSubscribeLocked(id, sub); err != nil {
+		// Nothing outside this call has seen sub yet (it was never visible
+		// while wc.mu was unlocked), so closing both channels here can't
+		// race a dispatch/finish call the way unsubscribe's close of ch
+		// could.
+		delete(wc.subs, id)
+		close(sub.ch)
+		close(sub.done)
+		return nil, err
+	}
+	return sub, nil
+}
+
+// unsubscribe stops a subscription from the caller's side, e.g. via
+// Subscription.Close or ctx cancellation. It only closes sub.done - closing
+// sub.ch here would race the read loop's dispatch, which may be blocked
+// sending on it - so sub.ch is left open. Since sub is removed from
+// wc.subs here, a later complete from the server no longer reaches finish,
+// and sub.ch is never closed.
+func (wc *wsConnection) unsubscribe(id string) error {
+	wc.mu.Lock()
+	sub, ok := wc.subs[id]
+	if !ok {
+		wc.mu.Unlock()
+		return nil
+	}
+	delete(wc.subs, id)
+
+	t := gwsStop
+	if wc.client.subProtocol == SubProtocolGraphQLTransportWS {
+		t = twsComplete
+	}
+	err := wc.writeMessageLocked(wsMessage{ID: id, Type: t})
+	empty := len(wc.subs) == 0
+	wc.mu.Unlock()
+
+	close(sub.done)
+	if empty {
+		wc.close()
+	}
+	return err
+}
+
+func (wc *wsConnection) sendSubscribeLocked(id string, sub *wsSubscription) error {
+	payload, err := json.Marshal(subscribePayload{
+		OperationName: sub.operationName,
+		Query:         sub.query,
+		Variables:     sub.variables,
+	})
+	if err != nil {
+		return err
+	}
+	t := gwsStart
+	if wc.client.subProtocol == SubProtocolGraphQLTransportWS {
+		t = twsSubscribe
+	}
+	return wc.writeMessageLocked(wsMessage{ID: id, Type: t, Payload: payload})
+}
+
+func (wc *wsConnection) writeMessage(msg wsMessage) error {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+	return wc.writeMessageLocked(msg)
+}
+
+func (wc *wsConnection) writeMessageLocked(msg wsMessage) error {
+	if wc.conn == nil {
+		return errors.New("graphql subscribe error: connection closed")
+	}
+	return wc.conn.WriteJSON(msg)
+}
+
+func (wc *wsConnection) pingLoop() {
+	ticker := time.NewTicker(wc.client.keepalive)
+	defer ticker.Stop()
+	for range ticker.C {
+		wc.mu.Lock()
+		closed := wc.closed
+		wc.mu.Unlock()
+		if closed {
+			return
+		}
+		wc.writeMessage(wsMessage{Type: twsPing})
+	}
+}
+
+// reconnect redials with exponential backoff and re-issues every subscription
+// that was still active. It returns false once the connection has been
+// closed deliberately, signalling the read loop to stop.
+func (wc *wsConnection) reconnect() bool {
+	wc.mu.Lock()
+	if wc.closed {
+		wc.mu.Unlock()
+		return false
+	}
+	wc.conn = nil
+	wc.mu.Unlock()
+
+	for attempt := 0; ; attempt++ {
+		wc.mu.Lock()
+		closed := wc.closed
+		wc.mu.Unlock()
+		if closed {
+			return false
+		}
+
+		time.Sleep(backoffDuration(attempt))
+		if err := wc.connect(context.Background()); err != nil {
+			continue
+		}
+
+		wc.mu.Lock()
+		for id, sub := range wc.subs {
+			wc.sendSubscribeLocked(id, sub)
+		}
+		wc.mu.Unlock()
+		return true
+	}
+}
+
+func backoffDuration(attempt int) time.Duration {
+	const (
+		base = time.Second
+		max  = 30 * time.Second
+	)
+	d := base << uint(attempt)
+	if d <= 0 || d > max {
+		d = max
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d)/2+1))
+}
+
+// close terminates the WebSocket and detaches the connection from its
+// client, so the next Subscribe call dials a fresh one.
+func (wc *wsConnection) close() error {
+	wc.mu.Lock()
+	if wc.closed {
+		wc.mu.Unlock()
+		return nil
+	}
+	wc.closed = true
+	conn := wc.conn
+	wc.conn = nil
+	wc.mu.Unlock()
+
+	wc.client.wsMu.Lock()
+	if wc.client.wsConn == wc {
+		wc.client.wsConn = nil
+	}
+	wc.client.wsMu.Unlock()
+
+	if conn == nil {
+		return nil
+	}
+	_ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	return conn.Close()
+}
@@ -0,0 +1,287 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// newSubscriptionServer upgrades every incoming connection to proto,
+// performs the connection_init/ack handshake, then repeatedly reads
+// messages, calling onSubscribe for each start/subscribe message it sees.
+func newSubscriptionServer(t *testing.T, proto SubProtocol, onSubscribe func(conn *websocket.Conn, sub wsMessage)) *httptest.Server {
+	upgrader := websocket.Upgrader{Subprotocols: []string{string(proto)}}
+	initType, ackType, subType := gwsConnectionInit, gwsConnectionAck, gwsStart
+	if proto == SubProtocolGraphQLTransportWS {
+		initType, ackType, subType = twsConnectionInit, twsConnectionAck, twsSubscribe
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade: %v", err)
+			return
+		}
+
+		var init wsMessage
+		if err := conn.ReadJSON(&init); err != nil || init.Type != initType {
+			t.Errorf("read init: msg=%+v err=%v", init, err)
+			return
+		}
+		if err := conn.WriteJSON(wsMessage{Type: ackType}); err != nil {
+			return
+		}
+
+		for {
+			var msg wsMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			if msg.Type == subType {
+				onSubscribe(conn, msg)
+			}
+		}
+	}))
+}
+
+func TestSubscribeGraphQLWS(t *testing.T) {
+	srv := newSubscriptionServer(t, SubProtocolGraphQLWS, func(conn *websocket.Conn, sub wsMessage) {
+		for i := 0; i < 2; i++ {
+			payload, _ := json.Marshal(Response{Data: JSON{"n": i}})
+			conn.WriteJSON(wsMessage{ID: sub.ID, Type: gwsData, Payload: payload})
+		}
+		conn.WriteJSON(wsMessage{ID: sub.ID, Type: gwsComplete})
+	})
+	defer srv.Close()
+
+	client := New(srv.URL, nil, WithSubProtocol(SubProtocolGraphQLWS))
+	sub, err := client.Subscribe(context.Background(), "subscription { n }", "", nil)
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+
+	var got []float64
+	for resp := range sub.C {
+		if resp.HasError() {
+			t.Fatalf("unexpected response error: %v", resp.Errors)
+		}
+		got = append(got, resp.Data["n"].(float64))
+	}
+	if len(got) != 2 || got[0] != 0 || got[1] != 1 {
+		t.Errorf("got %v, want [0 1]", got)
+	}
+}
+
+func TestSubscribeGraphQLTransportWS(t *testing.T) {
+	srv := newSubscriptionServer(t, SubProtocolGraphQLTransportWS, func(conn *websocket.Conn, sub wsMessage) {
+		payload, _ := json.Marshal(Response{Data: JSON{"n": 1}})
+		conn.WriteJSON(wsMessage{ID: sub.ID, Type: twsNext, Payload: payload})
+		conn.WriteJSON(wsMessage{ID: sub.ID, Type: twsComplete})
+	})
+	defer srv.Close()
+
+	client := New(srv.URL, nil, WithSubProtocol(SubProtocolGraphQLTransportWS))
+	sub, err := client.Subscribe(context.Background(), "subscription { n }", "", nil)
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+
+	resp, ok := <-sub.C
+	if !ok {
+		t.Fatal("channel closed before delivering a response")
+	}
+	if resp.Data["n"] != float64(1) {
+		t.Errorf("resp.Data = %v, want n=1", resp.Data)
+	}
+	if _, ok := <-sub.C; ok {
+		t.Error("channel did not close after the server sent complete")
+	}
+}
+
+func TestSubscribeReconnect(t *testing.T) {
+	var conns int32
+	upgrader := websocket.Upgrader{Subprotocols: []string{string(SubProtocolGraphQLTransportWS)}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade: %v", err)
+			return
+		}
+		n := atomic.AddInt32(&conns, 1)
+
+		var init wsMessage
+		if err := conn.ReadJSON(&init); err != nil || init.Type != twsConnectionInit {
+			t.Errorf("read init: msg=%+v err=%v", init, err)
+			return
+		}
+		conn.WriteJSON(wsMessage{Type: twsConnectionAck})
+
+		var sub wsMessage
+		if err := conn.ReadJSON(&sub); err != nil || sub.Type != twsSubscribe {
+			t.Errorf("read subscribe: msg=%+v err=%v", sub, err)
+			return
+		}
+
+		if n == 1 {
+			// Simulate the connection dropping before any data is sent; the
+			// client should reconnect and resend this subscribe.
+			conn.Close()
+			return
+		}
+
+		payload, _ := json.Marshal(Response{Data: JSON{"n": 1}})
+		conn.WriteJSON(wsMessage{ID: sub.ID, Type: twsNext, Payload: payload})
+		conn.WriteJSON(wsMessage{ID: sub.ID, Type: twsComplete})
+	}))
+	defer srv.Close()
+
+	client := New(srv.URL, nil, WithSubProtocol(SubProtocolGraphQLTransportWS))
+	sub, err := client.Subscribe(context.Background(), "subscription { n }", "", nil)
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+
+	select {
+	case resp, ok := <-sub.C:
+		if !ok {
+			t.Fatal("channel closed before delivering the resubscribed response")
+		}
+		if resp.Data["n"] != float64(1) {
+			t.Errorf("resp.Data = %v, want n=1", resp.Data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a response after reconnect")
+	}
+
+	if got := atomic.LoadInt32(&conns); got < 2 {
+		t.Errorf("server saw %d connections, want at least 2 (initial + reconnect)", got)
+	}
+}
+
+func TestSubscribeCleanupOnComplete(t *testing.T) {
+	srv := newSubscriptionServer(t, SubProtocolGraphQLTransportWS, func(conn *websocket.Conn, sub wsMessage) {
+		payload, _ := json.Marshal(Response{Data: JSON{"n": 0}})
+		conn.WriteJSON(wsMessage{ID: sub.ID, Type: twsNext, Payload: payload})
+		conn.WriteJSON(wsMessage{ID: sub.ID, Type: twsComplete})
+	})
+	defer srv.Close()
+
+	client := New(srv.URL, nil, WithSubProtocol(SubProtocolGraphQLTransportWS))
+
+	before := runtime.NumGoroutine()
+
+	const n = 20
+	for i := 0; i < n; i++ {
+		sub, err := client.Subscribe(context.Background(), "subscription { n }", "", nil)
+		if err != nil {
+			t.Fatalf("Subscribe() #%d error = %v", i, err)
+		}
+		for range sub.C {
+		}
+	}
+
+	var after int
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		after = runtime.NumGoroutine()
+		if after <= before+2 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if after > before+2 {
+		t.Errorf("goroutines before=%d after=%d draining %d subscriptions, watcher goroutines appear to leak", before, after, n)
+	}
+}
+
+// TestSubscribeCloseDuringDelivery races Subscription.Close, called from its
+// own goroutine, against the read loop's dispatch for the same subscription
+// still streaming data - dispatch must never send on a channel unsubscribe
+// is concurrently closing.
+func TestSubscribeCloseDuringDelivery(t *testing.T) {
+	upgrader := websocket.Upgrader{Subprotocols: []string{string(SubProtocolGraphQLTransportWS)}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade: %v", err)
+			return
+		}
+		defer conn.Close()
+
+		var writeMu sync.Mutex
+		writeJSON := func(msg wsMessage) error {
+			writeMu.Lock()
+			defer writeMu.Unlock()
+			return conn.WriteJSON(msg)
+		}
+
+		var init wsMessage
+		if err := conn.ReadJSON(&init); err != nil || init.Type != twsConnectionInit {
+			t.Errorf("read init: msg=%+v err=%v", init, err)
+			return
+		}
+		if err := writeJSON(wsMessage{Type: twsConnectionAck}); err != nil {
+			return
+		}
+
+		for {
+			var msg wsMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			if msg.Type != twsSubscribe {
+				continue
+			}
+
+			// Stream a few messages past the couple the client reads before
+			// calling Close, so dispatch is likely to still be sending when
+			// Close runs concurrently - but stay well under the channel's
+			// buffer (16) so dispatch is never blocked on a slow consumer,
+			// which would otherwise stall delivery to every other
+			// subscription sharing this connection's read loop.
+			id := msg.ID
+			go func() {
+				for i := 0; i < 8; i++ {
+					payload, _ := json.Marshal(Response{Data: JSON{"n": i}})
+					if writeJSON(wsMessage{ID: id, Type: twsNext, Payload: payload}) != nil {
+						return
+					}
+				}
+			}()
+		}
+	}))
+	defer srv.Close()
+
+	client := New(srv.URL, nil, WithSubProtocol(SubProtocolGraphQLTransportWS))
+
+	const n = 50
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			defer wg.Done()
+			sub, err := client.Subscribe(context.Background(), "subscription { n }", "", nil)
+			if err != nil {
+				t.Errorf("Subscribe() #%d error = %v", i, err)
+				return
+			}
+			for j := 0; j < 2; j++ {
+				if _, ok := <-sub.C; !ok {
+					break
+				}
+			}
+			if err := sub.Close(); err != nil {
+				t.Errorf("Close() #%d error = %v", i, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
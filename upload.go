@@ -0,0 +1,170 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+)
+
+// Upload wraps a NamedReader so a file can be placed anywhere inside the
+// variables passed to DoWithFiles. A bare NamedReader value works the same
+// way; Upload exists for cases where wrapping makes the intent explicit.
+type Upload struct {
+	File NamedReader
+}
+
+func writeField(w *multipart.Writer, fieldname string, value interface{}) error {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("write field %v error: %w", fieldname, err)
+	}
+	if err := w.WriteField(fieldname, string(b)); err != nil {
+		return fmt.Errorf("write field %v error: %w", fieldname, err)
+	}
+	return nil
+}
+
+func writeFile(w *multipart.Writer, fieldname string, file NamedReader) error {
+	f, err := w.CreateFormFile(fieldname, file.Name())
+	if err != nil {
+		return fmt.Errorf("write file %v error: %w", fieldname, err)
+	}
+	if _, err := io.Copy(f, file); err != nil {
+		return fmt.Errorf("write file %v error: %w", fieldname, err)
+	}
+	return nil
+}
+
+// extractFiles walks v, which is the value found at path within the request
+// variables, replacing any NamedReader or *Upload it finds with nil and
+// recording its path so DoWithFiles can build the "map" field of the
+// graphql-multipart-request-spec.
+func extractFiles(path string, v interface{}, files *[]NamedReader, paths *[]string) interface{} {
+	switch val := v.(type) {
+	case NamedReader:
+		*files = append(*files, val)
+		*paths = append(*paths, path)
+		return nil
+	case *Upload:
+		if val == nil || val.File == nil {
+			return nil
+		}
+		*files = append(*files, val.File)
+		*paths = append(*paths, path)
+		return nil
+	case JSON:
+		m := make(JSON, len(val))
+		for k, vv := range val {
+			m[k] = extractFiles(path+"."+k, vv, files, paths)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(val))
+		for k, vv := range val {
+			m[k] = extractFiles(path+"."+k, vv, files, paths)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(val))
+		for i, vv := range val {
+			s[i] = extractFiles(fmt.Sprintf("%s.%d", path, i), vv, files, paths)
+		}
+		return s
+	default:
+		return v
+	}
+}
+
+// buildMultipartRequest encodes req as a multipart/form-data request per the
+// GraphQL multipart request spec, using paths (one per req.Files entry) to
+// build the "map" field.
+func (c *Client) buildMultipartRequest(ctx context.Context, req *Request, paths []string) (*http.Request, error) {
+	if len(req.Files) == 0 {
+		return nil, errors.New("build form data request error: has no files")
+	}
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+
+	m := make(JSON, len(req.Files))
+	for i := range req.Files {
+		m[strconv.Itoa(i)] = []string{paths[i]}
+	}
+	if err := writeField(w, "operations", req); err != nil {
+		return nil, fmt.Errorf("build form data request error: %w", err)
+	}
+	if err := writeField(w, "map", m); err != nil {
+		return nil, fmt.Errorf("build form data request error: %w", err)
+	}
+	for i, file := range req.Files {
+		if err := writeFile(w, strconv.Itoa(i), file); err != nil {
+			return nil, fmt.Errorf("build form data request error: %w", err)
+		}
+	}
+	w.Close()
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.url, &body)
+	if err != nil {
+		return nil, fmt.Errorf("build form data request error: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", w.FormDataContentType())
+	return httpReq, nil
+}
+
+// DoWithFiles execs a graphql query or mutation whose variables may contain
+// file values (a NamedReader, or an *Upload) anywhere in the tree - nested
+// objects, slices, or top-level scalar fields. Files are walked out of
+// variables and sent as a multipart/form-data request per the
+// [GraphQL multipart request specification](https://github.com/jaydenseric/graphql-multipart-request-spec);
+// if variables contain no files, it is sent as a plain JSON POST through
+// the response middleware, without the Automatic Persisted Queries or
+// auto-batching that Do applies when the client was built with
+// WithPersistedQueries or WithBatching.
+func (c *Client) DoWithFiles(ctx context.Context, query, operationName string, variables JSON) (*Response, error) {
+	var files []NamedReader
+	var paths []string
+	cleaned := extractFiles("variables", variables, &files, &paths)
+
+	req := NewRequest(query, operationName, cleaned.(JSON))
+	if len(files) == 0 {
+		httpReq, err := c.buildJSONRequest(ctx, req)
+		if err != nil {
+			return nil, fmt.Errorf("graphql do error: %w", err)
+		}
+		return c.handler(ctx, req, httpReq)
+	}
+
+	req.Files = files
+	httpReq, err := c.buildMultipartRequest(ctx, req, paths)
+	if err != nil {
+		return nil, fmt.Errorf("graphql do with files error: %w", err)
+	}
+	return c.handler(ctx, req, httpReq)
+}
+
+// SingleUpload implement [GraphQL multipart request specification](https://github.com/jaydenseric/graphql-multipart-request-spec)
+func (c *Client) SingleUpload(ctx context.Context, query, operationName string, file NamedReader) (*Response, error) {
+	resp, err := c.DoWithFiles(ctx, query, operationName, JSON{"file": file})
+	if err != nil {
+		return nil, fmt.Errorf("graphql single upload error: %w", err)
+	}
+	return resp, nil
+}
+
+// MultiUpload implement [GraphQL multipart request specification](https://github.com/jaydenseric/graphql-multipart-request-spec)
+func (c *Client) MultiUpload(ctx context.Context, query, operationName string, file ...NamedReader) (*Response, error) {
+	files := make([]interface{}, len(file))
+	for i, f := range file {
+		files[i] = f
+	}
+	resp, err := c.DoWithFiles(ctx, query, operationName, JSON{"files": files})
+	if err != nil {
+		return nil, fmt.Errorf("graphql single upload error: %w", err)
+	}
+	return resp, nil
+}
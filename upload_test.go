@@ -0,0 +1,228 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+type fakeFile struct {
+	name    string
+	content []byte
+}
+
+func (f *fakeFile) Read(p []byte) (int, error) {
+	n := copy(p, f.content)
+	f.content = f.content[n:]
+	if n == 0 {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+func (f *fakeFile) Name() string { return f.name }
+
+func TestExtractFiles(t *testing.T) {
+	avatar := &fakeFile{name: "avatar.png"}
+	attachment := &fakeFile{name: "report.pdf"}
+
+	variables := JSON{
+		"title": "hello",
+		"profile": JSON{
+			"avatar": avatar,
+		},
+		"items": []interface{}{
+			JSON{"name": "a"},
+			JSON{"attachment": attachment},
+		},
+	}
+
+	var files []NamedReader
+	var paths []string
+	cleaned := extractFiles("variables", variables, &files, &paths)
+
+	if len(files) != len(paths) {
+		t.Fatalf("extractFiles() returned %d files but %d paths", len(files), len(paths))
+	}
+	got := make(map[string]NamedReader, len(paths))
+	for i, p := range paths {
+		got[p] = files[i]
+	}
+	want := map[string]NamedReader{
+		"variables.profile.avatar":     avatar,
+		"variables.items.1.attachment": attachment,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("extractFiles() paths->files = %v, want %v", got, want)
+	}
+
+	m, ok := cleaned.(JSON)
+	if !ok {
+		t.Fatalf("extractFiles() cleaned type = %T, want JSON", cleaned)
+	}
+	profile, ok := m["profile"].(JSON)
+	if !ok || profile["avatar"] != nil {
+		t.Errorf("extractFiles() did not null out nested file, got %v", m["profile"])
+	}
+}
+
+// uploadedPart is what the test server records about one multipart part.
+type uploadedPart struct {
+	contentType string
+	content     []byte
+}
+
+// uploadOperations mirrors the JSON shape of the "operations" multipart
+// field: a Request with its file variables nulled out, so it decodes
+// cleanly (Request.Files is a NamedReader, which isn't JSON-unmarshalable).
+type uploadOperations struct {
+	OperationName string `json:"operationName"`
+	Query         string `json:"query"`
+	Variables     JSON   `json:"variables"`
+}
+
+// parseMultipartRequest reads r as a graphql-multipart-request-spec request,
+// returning the decoded "operations" and "map" fields plus every other part
+// keyed by its form field name.
+func parseMultipartRequest(t *testing.T, r *http.Request) (operations uploadOperations, m map[string][]string, files map[string]uploadedPart) {
+	t.Helper()
+
+	_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("parse Content-Type: %v", err)
+	}
+	mr := multipart.NewReader(r.Body, params["boundary"])
+
+	files = make(map[string]uploadedPart)
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("read part: %v", err)
+		}
+
+		switch name := part.FormName(); name {
+		case "operations":
+			if err := json.NewDecoder(part).Decode(&operations); err != nil {
+				t.Fatalf("decode operations: %v", err)
+			}
+		case "map":
+			if err := json.NewDecoder(part).Decode(&m); err != nil {
+				t.Fatalf("decode map: %v", err)
+			}
+		default:
+			b, err := io.ReadAll(part)
+			if err != nil {
+				t.Fatalf("read part %v: %v", name, err)
+			}
+			files[name] = uploadedPart{contentType: part.Header.Get("Content-Type"), content: b}
+		}
+	}
+	return operations, m, files
+}
+
+func TestSingleUploadMultipartRequest(t *testing.T) {
+	var gotOps uploadOperations
+	var gotMap map[string][]string
+	var gotFiles map[string]uploadedPart
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotOps, gotMap, gotFiles = parseMultipartRequest(t, r)
+		w.Write([]byte(`{"data":{"ok":true}}`))
+	}))
+	defer srv.Close()
+
+	client := New(srv.URL, nil)
+	file := &fakeFile{name: "avatar.png"}
+	resp, err := client.SingleUpload(context.Background(), "mutation ($file: Upload!) { upload(file: $file) }", "", file)
+	if err != nil {
+		t.Fatalf("SingleUpload() error = %v", err)
+	}
+	if resp.Data["ok"] != true {
+		t.Errorf("resp.Data = %v, want ok=true", resp.Data)
+	}
+
+	if gotOps.Variables["file"] != nil {
+		t.Errorf("operations.variables.file = %v, want nil (replaced by the map)", gotOps.Variables["file"])
+	}
+	wantMap := map[string][]string{"0": {"variables.file"}}
+	if !reflect.DeepEqual(gotMap, wantMap) {
+		t.Errorf("map = %v, want %v", gotMap, wantMap)
+	}
+	if _, ok := gotFiles["0"]; !ok {
+		t.Fatalf("server did not receive a file part named %q, got %v", "0", gotFiles)
+	}
+}
+
+func TestMultiUploadMultipartRequest(t *testing.T) {
+	var gotOps uploadOperations
+	var gotMap map[string][]string
+	var gotFiles map[string]uploadedPart
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotOps, gotMap, gotFiles = parseMultipartRequest(t, r)
+		w.Write([]byte(`{"data":{"ok":true}}`))
+	}))
+	defer srv.Close()
+
+	client := New(srv.URL, nil)
+	a := &fakeFile{name: "a.txt"}
+	b := &fakeFile{name: "b.txt"}
+	if _, err := client.MultiUpload(context.Background(), "mutation ($files: [Upload!]!) { upload(files: $files) }", "", a, b); err != nil {
+		t.Fatalf("MultiUpload() error = %v", err)
+	}
+
+	wantMap := map[string][]string{"0": {"variables.files.0"}, "1": {"variables.files.1"}}
+	if !reflect.DeepEqual(gotMap, wantMap) {
+		t.Errorf("map = %v, want %v", gotMap, wantMap)
+	}
+	files, ok := gotOps.Variables["files"].([]interface{})
+	if !ok || len(files) != 2 || files[0] != nil || files[1] != nil {
+		t.Errorf("operations.variables.files = %v, want [nil, nil]", gotOps.Variables["files"])
+	}
+	if len(gotFiles) != 2 {
+		t.Errorf("server received %d file parts, want 2", len(gotFiles))
+	}
+}
+
+func TestDoWithFilesMultipartContentType(t *testing.T) {
+	var gotFiles map[string]uploadedPart
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _, gotFiles = parseMultipartRequest(t, r)
+		w.Write([]byte(`{"data":{"ok":true}}`))
+	}))
+	defer srv.Close()
+
+	client := New(srv.URL, nil)
+	const wantContent = "png-bytes"
+	avatar := &fakeFile{name: "avatar.png", content: []byte(wantContent)}
+	variables := JSON{
+		"title": "hello",
+		"profile": JSON{
+			"avatar": avatar,
+		},
+	}
+	if _, err := client.DoWithFiles(context.Background(), "mutation ($title: String!, $profile: ProfileInput!) { ok }", "", variables); err != nil {
+		t.Fatalf("DoWithFiles() error = %v", err)
+	}
+
+	got, ok := gotFiles["0"]
+	if !ok {
+		t.Fatalf("server did not receive a file part named %q, got %v", "0", gotFiles)
+	}
+	if !bytes.Equal(got.content, []byte(wantContent)) {
+		t.Errorf("uploaded file content = %q, want %q", got.content, wantContent)
+	}
+	if got.contentType == "" {
+		t.Error("uploaded file part had no Content-Type")
+	}
+}